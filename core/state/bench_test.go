@@ -0,0 +1,133 @@
+/**
+* @file
+* @copyright defined in go-seele/LICENSE
+ */
+
+package state
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/seeleteam/go-seele/common"
+	"github.com/seeleteam/go-seele/database"
+)
+
+// benchDB is a minimal in-memory database.Database, good enough for storage
+// tries to read and write against in these benchmarks.
+type benchDB struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func newBenchDB() *benchDB {
+	return &benchDB{data: make(map[string][]byte)}
+}
+
+func (d *benchDB) Get(key []byte) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if v, ok := d.data[string(key)]; ok {
+		return v, nil
+	}
+	return nil, errors.New("benchDB: not found")
+}
+
+func (d *benchDB) NewIterator(prefix []byte) database.Iterator {
+	panic("benchDB: NewIterator is not exercised by these benchmarks")
+}
+
+func (d *benchDB) put(key, value []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.data[string(key)] = append([]byte{}, value...)
+}
+
+// benchBatch is the database.Batch counterpart to benchDB.
+type benchBatch struct {
+	db *benchDB
+}
+
+func (b *benchBatch) Put(key, value []byte) {
+	b.db.put(key, value)
+}
+
+func (b *benchBatch) Delete(key []byte) {
+	b.db.mu.Lock()
+	defer b.db.mu.Unlock()
+	delete(b.db.data, string(key))
+}
+
+// benchSlot returns a distinct storage key for every i in [0, 256).
+func benchSlot(i int) common.Hash {
+	var h common.Hash
+	h[len(h)-1] = byte(i)
+	return h
+}
+
+// benchContracts returns n freshly created state objects, each with m dirty
+// storage slots pending a commit.
+func benchContracts(db database.Database, n, m int) []*StateObject {
+	objs := make([]*StateObject, n)
+
+	for i := 0; i < n; i++ {
+		obj := newStateObject(testAddress(i))
+		for k := 0; k < m; k++ {
+			obj.SetState(db, benchSlot(k), []byte{byte(k + 1)})
+		}
+		objs[i] = obj
+	}
+
+	return objs
+}
+
+func commitSerial(objs []*StateObject, db database.Database) {
+	for _, obj := range objs {
+		obj.updateStorageTrie(db)
+	}
+}
+
+func commitParallel(objs []*StateObject, db database.Database) {
+	var wg sync.WaitGroup
+	for _, obj := range objs {
+		wg.Add(1)
+		go func(o *StateObject) {
+			defer wg.Done()
+			o.updateStorageTrie(db)
+		}(obj)
+	}
+	wg.Wait()
+}
+
+// runCommitBenchmark measures committing n contracts with m dirty slots
+// each, rebuilding the dirty set every iteration since updateStorageTrie
+// drains it as it goes.
+func runCommitBenchmark(b *testing.B, n, m int, commit func([]*StateObject, database.Database)) {
+	db := newBenchDB()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		objs := benchContracts(db, n, m)
+		b.StartTimer()
+
+		commit(objs, db)
+	}
+}
+
+func BenchmarkCommitSerial_100Contracts_10Slots(b *testing.B) {
+	runCommitBenchmark(b, 100, 10, commitSerial)
+}
+
+func BenchmarkCommitParallel_100Contracts_10Slots(b *testing.B) {
+	runCommitBenchmark(b, 100, 10, commitParallel)
+}
+
+func BenchmarkCommitSerial_1000Contracts_20Slots(b *testing.B) {
+	runCommitBenchmark(b, 1000, 20, commitSerial)
+}
+
+func BenchmarkCommitParallel_1000Contracts_20Slots(b *testing.B) {
+	runCommitBenchmark(b, 1000, 20, commitParallel)
+}
@@ -0,0 +1,69 @@
+/**
+* @file
+* @copyright defined in go-seele/LICENSE
+ */
+
+package state
+
+import (
+	"encoding/hex"
+	"encoding/json"
+)
+
+// DumpAccount is the JSON representation of a single account as returned by
+// Statedb.Dump.
+type DumpAccount struct {
+	Balance  string            `json:"balance"`
+	Nonce    uint64            `json:"nonce"`
+	Code     string            `json:"code,omitempty"`
+	CodeHash string            `json:"codeHash,omitempty"`
+	Storage  map[string]string `json:"storage,omitempty"`
+}
+
+// Dump is the JSON representation of an entire Statedb at a given root,
+// used for debugging, offline auditing and state-diffing between blocks.
+type Dump struct {
+	Root     string                 `json:"root"`
+	Accounts map[string]DumpAccount `json:"accounts"`
+}
+
+// RawDump returns every account reachable from the state trie, including
+// in-memory modifications that have not yet been committed.
+func (s *Statedb) RawDump() Dump {
+	dump := Dump{
+		Root:     s.root.Hex(),
+		Accounts: make(map[string]DumpAccount),
+	}
+
+	it := newNodeIterator(s)
+	for it.Next() {
+		account := DumpAccount{
+			Balance:  it.Account().Amount.String(),
+			Nonce:    it.Account().Nonce,
+			CodeHash: hex.EncodeToString(it.Account().CodeHash),
+		}
+
+		if code := it.Code(); len(code) > 0 {
+			account.Code = hex.EncodeToString(code)
+		}
+
+		if storage := it.Storage(); len(storage) > 0 {
+			account.Storage = storage
+		}
+
+		dump.Accounts[it.Address().Hex()] = account
+	}
+
+	return dump
+}
+
+// Dump returns the JSON serialization of RawDump, for use by debugging RPCs
+// such as debug_dumpBlock.
+func (s *Statedb) Dump() []byte {
+	data, err := json.MarshalIndent(s.RawDump(), "", "    ")
+	if err != nil {
+		return nil
+	}
+
+	return data
+}
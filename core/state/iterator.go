@@ -0,0 +1,163 @@
+/**
+* @file
+* @copyright defined in go-seele/LICENSE
+ */
+
+package state
+
+import (
+	"github.com/seeleteam/go-seele/common"
+	"github.com/seeleteam/go-seele/trie"
+)
+
+// NodeIterator walks every account reachable from a Statedb's state trie,
+// descending into each account's storage trie along the way. Accounts and
+// storage slots that were modified in memory but not yet committed are
+// read through the live state objects, so that the walk reflects the
+// Statedb's current view rather than only what has been flushed to disk.
+type NodeIterator struct {
+	statedb *Statedb
+
+	pending   []common.Address // cached (live, not deleted) accounts not yet visited
+	accountIt *trie.Iterator
+
+	addr    common.Address
+	account Account
+	object  *StateObject
+}
+
+// newNodeIterator creates a NodeIterator positioned before the first
+// account of s.
+func newNodeIterator(s *Statedb) *NodeIterator {
+	it := &NodeIterator{
+		statedb:   s,
+		accountIt: s.trie.NewIterator(),
+	}
+
+	for _, key := range s.stateObjects.Keys() {
+		if value, ok := s.stateObjects.Peek(key); ok {
+			if object := value.(*StateObject); !object.deleted {
+				it.pending = append(it.pending, key.(common.Address))
+			}
+		}
+	}
+
+	return it
+}
+
+// Next advances the iterator to the next account, returning false once
+// every account has been visited.
+func (it *NodeIterator) Next() bool {
+	for len(it.pending) > 0 {
+		addr := it.pending[0]
+		it.pending = it.pending[1:]
+
+		object := it.statedb.getStateObject(addr)
+		if object == nil {
+			continue
+		}
+
+		it.addr = addr
+		it.account = object.account
+		it.object = object
+
+		return true
+	}
+
+	for it.accountIt.Next() {
+		addr := common.BytesToAddress(it.accountIt.Key)
+
+		// Already surfaced through the state cache above, or deleted there.
+		if _, ok := it.statedb.stateObjects.Peek(addr); ok {
+			continue
+		}
+
+		var account Account
+		if err := common.Deserialize(it.accountIt.Value, &account); err != nil {
+			continue
+		}
+
+		it.addr = addr
+		it.account = account
+		it.object = nil
+
+		return true
+	}
+
+	return false
+}
+
+// Address returns the address of the account at the current position.
+func (it *NodeIterator) Address() common.Address {
+	return it.addr
+}
+
+// Account returns the account data at the current position.
+func (it *NodeIterator) Account() Account {
+	return it.account
+}
+
+// Code returns the contract code of the account at the current position, or
+// nil if it has none.
+func (it *NodeIterator) Code() []byte {
+	if it.object != nil {
+		return it.object.GetCode(it.statedb.db)
+	}
+
+	if len(it.account.CodeHash) == 0 {
+		return nil
+	}
+
+	code, err := it.statedb.db.Get(it.account.CodeHash)
+	if err != nil {
+		return nil
+	}
+
+	return code
+}
+
+// Storage returns every storage slot of the account at the current
+// position, keyed by storage key hex with hex-encoded values. Uncommitted
+// writes held by the live state object take precedence over the storage
+// trie's persisted contents.
+func (it *NodeIterator) Storage() map[string]string {
+	storage := make(map[string]string)
+	seen := make(map[common.Hash]struct{})
+
+	if it.object != nil {
+		for key, value := range it.object.dirtyStorage {
+			seen[key] = struct{}{}
+			if len(value) > 0 {
+				storage[key.Hex()] = common.BytesToHash(value).Hex()
+			}
+		}
+
+		for key, value := range it.object.cachedStorage {
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+
+			if len(value) > 0 {
+				storage[key.Hex()] = common.BytesToHash(value).Hex()
+			}
+		}
+	}
+
+	tr, err := trie.NewTrie(it.account.StorageRootHash, it.addr.Bytes(), it.statedb.db)
+	if err != nil {
+		return storage
+	}
+
+	storageIt := tr.NewIterator()
+	for storageIt.Next() {
+		key := common.BytesToHash(storageIt.Key)
+		if _, ok := seen[key]; ok {
+			continue // shadowed (possibly deleted) by an uncommitted write above
+		}
+
+		storage[key.Hex()] = common.BytesToHash(storageIt.Value).Hex()
+	}
+
+	return storage
+}
@@ -0,0 +1,185 @@
+/**
+* @file
+* @copyright defined in go-seele/LICENSE
+ */
+
+package state
+
+import (
+	"math/big"
+
+	"github.com/seeleteam/go-seele/common"
+)
+
+// journalEntry is a single state modification that can be reverted.
+type journalEntry interface {
+	// revert undoes the effect of this journal entry on the given Statedb.
+	revert(s *Statedb)
+
+	// dirtied returns the address modified by this entry, or nil if the
+	// entry is not tied to a single account.
+	dirtied() *common.Address
+}
+
+// journal is an append-only log of state modifications recorded during the
+// processing of a single transaction, used to implement Statedb.Snapshot
+// and Statedb.RevertToSnapshot.
+type journal struct {
+	entries []journalEntry
+}
+
+// append adds a new entry to the journal.
+func (j *journal) append(entry journalEntry) {
+	j.entries = append(j.entries, entry)
+}
+
+// revert undoes all journal entries recorded after the given index, in
+// reverse order, and truncates the journal to that index.
+func (j *journal) revert(s *Statedb, snapshot int) {
+	for i := len(j.entries) - 1; i >= snapshot; i-- {
+		j.entries[i].revert(s)
+	}
+
+	j.entries = j.entries[:snapshot]
+}
+
+// length returns the number of entries currently recorded in the journal.
+func (j *journal) length() int {
+	return len(j.entries)
+}
+
+type (
+	// createObjectChange is recorded when a state object didn't exist before.
+	createObjectChange struct {
+		account *common.Address
+	}
+
+	// resetObjectChange is recorded when a state object is replaced, e.g. a
+	// suicided account is recreated within the same transaction. It keeps a
+	// deep copy of the previous object so the replacement can be undone.
+	resetObjectChange struct {
+		prev *StateObject
+	}
+
+	suicideChange struct {
+		account     *common.Address
+		prev        bool // whether the account had already suicided
+		prevbalance *big.Int
+	}
+
+	balanceChange struct {
+		account *common.Address
+		prev    *big.Int
+	}
+
+	nonceChange struct {
+		account *common.Address
+		prev    uint64
+	}
+
+	storageChange struct {
+		account  *common.Address
+		key      common.Hash
+		prevalue []byte
+	}
+
+	codeChange struct {
+		account  *common.Address
+		prevcode []byte
+		prevhash []byte
+	}
+
+	refundChange struct {
+		prev uint64
+	}
+
+	addLogChange struct {
+	}
+)
+
+func (ch createObjectChange) revert(s *Statedb) {
+	s.stateObjects.Remove(*ch.account)
+}
+
+func (ch createObjectChange) dirtied() *common.Address {
+	return ch.account
+}
+
+func (ch resetObjectChange) revert(s *Statedb) {
+	s.setStateObject(ch.prev)
+}
+
+func (ch resetObjectChange) dirtied() *common.Address {
+	return &ch.prev.address
+}
+
+func (ch suicideChange) revert(s *Statedb) {
+	if object := s.getStateObject(*ch.account); object != nil {
+		object.suicided = ch.prev
+		object.setAmount(ch.prevbalance)
+	}
+
+	if !ch.prev {
+		delete(s.stateObjectsDestructed, *ch.account)
+	}
+}
+
+func (ch suicideChange) dirtied() *common.Address {
+	return ch.account
+}
+
+func (ch balanceChange) revert(s *Statedb) {
+	if object := s.getStateObject(*ch.account); object != nil {
+		object.setAmount(ch.prev)
+	}
+}
+
+func (ch balanceChange) dirtied() *common.Address {
+	return ch.account
+}
+
+func (ch nonceChange) revert(s *Statedb) {
+	if object := s.getStateObject(*ch.account); object != nil {
+		object.setNonce(ch.prev)
+	}
+}
+
+func (ch nonceChange) dirtied() *common.Address {
+	return ch.account
+}
+
+func (ch storageChange) revert(s *Statedb) {
+	if object := s.getStateObject(*ch.account); object != nil {
+		object.setState(ch.key, ch.prevalue)
+	}
+}
+
+func (ch storageChange) dirtied() *common.Address {
+	return ch.account
+}
+
+func (ch codeChange) revert(s *Statedb) {
+	if object := s.getStateObject(*ch.account); object != nil {
+		object.setCode(ch.prevhash, ch.prevcode)
+	}
+}
+
+func (ch codeChange) dirtied() *common.Address {
+	return ch.account
+}
+
+func (ch refundChange) revert(s *Statedb) {
+	s.refund = ch.prev
+}
+
+func (ch refundChange) dirtied() *common.Address {
+	return nil
+}
+
+func (ch addLogChange) revert(s *Statedb) {
+	s.curLogs = s.curLogs[:len(s.curLogs)-1]
+}
+
+func (ch addLogChange) dirtied() *common.Address {
+	return nil
+}
@@ -0,0 +1,128 @@
+/**
+* @file
+* @copyright defined in go-seele/LICENSE
+ */
+
+package state
+
+import (
+	"sync"
+
+	"github.com/seeleteam/go-seele/common"
+)
+
+// accountNonce tracks the pending nonce window for a single account: nonce
+// is the first outstanding nonce, and nonces[i] records whether nonce+i is
+// still outstanding (true) or has been consumed/removed (false).
+type accountNonce struct {
+	nonce  uint64
+	nonces []bool
+}
+
+// ManagedState wraps a Statedb and hands out "next nonce" values that
+// account for transactions still pending in the pool, not just what has
+// been committed to the trie. Callers that submit several transactions from
+// the same address in quick succession should use NewNonce instead of
+// reading Statedb.GetNonce directly, since the latter would hand out the
+// same nonce to every pending transaction.
+//
+// Wiring this into the tx pool (AddTransaction calling NewNonce, rejected or
+// mined transactions calling RemoveNonce) is still pending: there is no
+// tx-pool package in this tree yet for it to live in.
+type ManagedState struct {
+	*Statedb
+
+	mu       sync.Mutex
+	accounts map[common.Address]*accountNonce
+}
+
+// NewManagedState creates a ManagedState backed by statedb.
+func NewManagedState(statedb *Statedb) *ManagedState {
+	return &ManagedState{
+		Statedb:  statedb,
+		accounts: make(map[common.Address]*accountNonce),
+	}
+}
+
+// HasAccount returns whether addr has a pending nonce window tracked.
+func (m *ManagedState) HasAccount(addr common.Address) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.accounts[addr]
+	return ok
+}
+
+// GetNonce returns the next nonce for addr that accounts for transactions
+// still pending in the window, without consuming it.
+func (m *ManagedState) GetNonce(addr common.Address) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account := m.getAccount(addr)
+	return account.nonce + uint64(len(account.nonces))
+}
+
+// NewNonce returns the next pending nonce for addr and marks it as
+// outstanding, so that a subsequent call returns the following one.
+func (m *ManagedState) NewNonce(addr common.Address) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account := m.getAccount(addr)
+	next := account.nonce + uint64(len(account.nonces))
+	account.nonces = append(account.nonces, true)
+
+	return next
+}
+
+// SetNonce sets the confirmed nonce for addr and discards its whole pending
+// window, so that the next NewNonce returns nonce.
+func (m *ManagedState) SetNonce(addr common.Address, nonce uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Statedb.SetNonce(addr, nonce)
+
+	m.accounts[addr] = &accountNonce{nonce: nonce}
+}
+
+// RemoveNonce marks the pending nonce as consumed or failed, allowing the
+// pending window to compact. It is a no-op if nonce falls outside the
+// tracked window.
+func (m *ManagedState) RemoveNonce(addr common.Address, nonce uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account := m.getAccount(addr)
+	if nonce < account.nonce || nonce >= account.nonce+uint64(len(account.nonces)) {
+		return
+	}
+
+	account.nonces[nonce-account.nonce] = false
+	account.compact()
+}
+
+// getAccount returns the tracked nonce window for addr, seeding it from the
+// underlying Statedb on first access.
+func (m *ManagedState) getAccount(addr common.Address) *accountNonce {
+	account, ok := m.accounts[addr]
+	if !ok {
+		account = &accountNonce{nonce: m.Statedb.GetNonce(addr)}
+		m.accounts[addr] = account
+	}
+
+	return account
+}
+
+// compact drops the leading run of consumed nonces, advancing nonce past
+// them so that the pending window doesn't grow without bound.
+func (a *accountNonce) compact() {
+	consumed := 0
+	for consumed < len(a.nonces) && !a.nonces[consumed] {
+		consumed++
+	}
+
+	a.nonce += uint64(consumed)
+	a.nonces = a.nonces[consumed:]
+}
@@ -0,0 +1,19 @@
+/**
+* @file
+* @copyright defined in go-seele/LICENSE
+ */
+
+package state
+
+import "github.com/seeleteam/go-seele/metrics"
+
+// Metrics instrumenting Statedb reads and commits, surfaced through the
+// common metrics registry alongside the rest of the node's metrics.
+var (
+	accountReadTimer   = metrics.GetOrRegisterTimer("state/account/reads", nil)
+	storageReadTimer   = metrics.GetOrRegisterTimer("state/storage/reads", nil)
+	trieHashTimer      = metrics.GetOrRegisterTimer("state/trie/hashes", nil)
+	trieCommitTimer    = metrics.GetOrRegisterTimer("state/trie/commits", nil)
+	accountCommitMeter = metrics.GetOrRegisterMeter("state/account/commits", nil)
+	storageCommitMeter = metrics.GetOrRegisterMeter("state/storage/commits", nil)
+)
@@ -0,0 +1,69 @@
+/**
+* @file
+* @copyright defined in go-seele/LICENSE
+ */
+
+package state
+
+import (
+	"math/big"
+	"testing"
+)
+
+// These tests exercise Snapshot/RevertToSnapshot against already-cached
+// state objects, staying clear of the trie/database so they can run without
+// a backing store.
+
+func TestRevertToSnapshotUndoesBalanceChange(t *testing.T) {
+	s := newTestStatedb(t)
+	addr := testAddress(0)
+	s.cache(addr, newStateObject(addr))
+
+	s.SetBalance(addr, big.NewInt(1))
+	snap := s.Snapshot()
+	s.SetBalance(addr, big.NewInt(2))
+
+	s.RevertToSnapshot(snap)
+
+	if balance := s.GetBalance(addr); balance.Cmp(big.NewInt(1)) != 0 {
+		t.Fatalf("balance = %v after revert, want 1", balance)
+	}
+}
+
+func TestRevertToSnapshotUndoesSuicideAndItsDestructMark(t *testing.T) {
+	s := newTestStatedb(t)
+	addr := testAddress(0)
+	s.cache(addr, newStateObject(addr))
+
+	snap := s.Snapshot()
+	s.Suicide(addr)
+
+	if !s.HasSuicided(addr) {
+		t.Fatalf("HasSuicided = false right after Suicide")
+	}
+	if _, ok := s.stateObjectsDestructed[addr]; !ok {
+		t.Fatalf("stateObjectsDestructed missing addr right after Suicide")
+	}
+
+	s.RevertToSnapshot(snap)
+
+	if s.HasSuicided(addr) {
+		t.Fatalf("HasSuicided = true after reverting the Suicide")
+	}
+	if _, ok := s.stateObjectsDestructed[addr]; ok {
+		t.Fatalf("stateObjectsDestructed still holds addr after reverting the Suicide that set it")
+	}
+}
+
+func TestRevertToSnapshotUnknownRevisionPanics(t *testing.T) {
+	s := newTestStatedb(t)
+	s.Snapshot()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("RevertToSnapshot with an unknown revision id did not panic")
+		}
+	}()
+
+	s.RevertToSnapshot(999)
+}
@@ -0,0 +1,140 @@
+/**
+* @file
+* @copyright defined in go-seele/LICENSE
+ */
+
+package snapshot
+
+import (
+	"sync"
+
+	"github.com/seeleteam/go-seele/common"
+)
+
+// diffLayer is an in-memory snapshot layer capturing the accounts and
+// storage slots touched while processing a single block, stacked on top of
+// an older Snapshot (either another diffLayer or the diskLayer).
+type diffLayer struct {
+	parent Snapshot
+	root   common.Hash
+
+	lock  sync.RWMutex
+	stale bool
+
+	// destructSet records addresses that were suicided while this layer was
+	// built; it stops Account/Storage lookups from falling through to an
+	// older layer that still has data for the destroyed address.
+	destructSet map[common.Hash]struct{}
+	accountData map[common.Hash][]byte
+	storageData map[common.Hash]map[common.Hash][]byte
+}
+
+func newDiffLayer(parent Snapshot, root common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) *diffLayer {
+	if destructs == nil {
+		destructs = make(map[common.Hash]struct{})
+	}
+	if accounts == nil {
+		accounts = make(map[common.Hash][]byte)
+	}
+	if storage == nil {
+		storage = make(map[common.Hash]map[common.Hash][]byte)
+	}
+
+	return &diffLayer{
+		parent:      parent,
+		root:        root,
+		destructSet: destructs,
+		accountData: accounts,
+		storageData: storage,
+	}
+}
+
+// Root returns the state root this diff layer represents.
+func (dl *diffLayer) Root() common.Hash {
+	return dl.root
+}
+
+// Parent returns the layer this diff was built on top of.
+func (dl *diffLayer) Parent() Snapshot {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.parent
+}
+
+// Stale reports whether this diff layer has already been merged into the
+// disk layer and so must no longer be read from.
+func (dl *diffLayer) Stale() bool {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.stale
+}
+
+// Account returns the serialized account for addrHash, consulting this
+// layer first and then falling through to the parent chain. An address
+// present in destructSet without a fresher entry in accountData is reported
+// as non-existent without consulting older layers.
+func (dl *diffLayer) Account(addrHash common.Hash) ([]byte, error) {
+	if dl.Stale() {
+		return nil, ErrSnapshotStale
+	}
+
+	dl.lock.RLock()
+	account, ok := dl.accountData[addrHash]
+	if ok {
+		dl.lock.RUnlock()
+		return account, nil
+	}
+
+	_, destructed := dl.destructSet[addrHash]
+	parent := dl.parent
+	dl.lock.RUnlock()
+
+	if destructed {
+		return nil, nil
+	}
+
+	return parent.Account(addrHash)
+}
+
+// Storage returns the storage value for addrHash/storageHash, consulting
+// this layer first and then falling through to the parent chain. Once
+// addrHash is found in destructSet the walk stops, so that storage slots of
+// an account destroyed in this layer never leak in from an older layer even
+// if the address was later recreated further up the stack.
+func (dl *diffLayer) Storage(addrHash, storageHash common.Hash) ([]byte, error) {
+	if dl.Stale() {
+		return nil, ErrSnapshotStale
+	}
+
+	dl.lock.RLock()
+	if slots, ok := dl.storageData[addrHash]; ok {
+		if value, ok := slots[storageHash]; ok {
+			dl.lock.RUnlock()
+			return value, nil
+		}
+	}
+
+	_, destructed := dl.destructSet[addrHash]
+	parent := dl.parent
+	dl.lock.RUnlock()
+
+	if destructed {
+		return nil, nil
+	}
+
+	return parent.Storage(addrHash, storageHash)
+}
+
+// AccountIterator returns an iterator merging the accounts visible from
+// this layer down through every ancestor.
+func (dl *diffLayer) AccountIterator() AccountIterator {
+	return newDiffAccountIterator(dl)
+}
+
+// StorageIterator returns an iterator merging the storage slots of addrHash
+// visible from this layer down through every ancestor.
+func (dl *diffLayer) StorageIterator(addrHash common.Hash) StorageIterator {
+	return newDiffStorageIterator(dl, addrHash)
+}
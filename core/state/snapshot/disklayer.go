@@ -0,0 +1,126 @@
+/**
+* @file
+* @copyright defined in go-seele/LICENSE
+ */
+
+package snapshot
+
+import (
+	"sync"
+
+	"github.com/seeleteam/go-seele/common"
+	"github.com/seeleteam/go-seele/database"
+)
+
+// diskLayer is the bottom-most snapshot layer, its accounts and storage
+// slots having already been flushed to the persistent database.
+type diskLayer struct {
+	db   database.Database
+	root common.Hash
+
+	lock  sync.RWMutex
+	stale bool // set once a newer diff layer has been flattened into this one
+}
+
+func newDiskLayer(db database.Database, root common.Hash) *diskLayer {
+	return &diskLayer{db: db, root: root}
+}
+
+// Root returns the state root of the disk layer.
+func (dl *diskLayer) Root() common.Hash {
+	return dl.root
+}
+
+// Parent always returns nil for the disk layer.
+func (dl *diskLayer) Parent() Snapshot {
+	return nil
+}
+
+// Stale reports whether this disk layer has been superseded by a more
+// recent flatten, making it unsafe to read from any longer.
+func (dl *diskLayer) Stale() bool {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.stale
+}
+
+// Account reads the serialized account for addrHash directly from the
+// database.
+func (dl *diskLayer) Account(addrHash common.Hash) ([]byte, error) {
+	if dl.Stale() {
+		return nil, ErrSnapshotStale
+	}
+
+	data, err := dl.db.Get(accountSnapshotKey(addrHash))
+	if err != nil {
+		return nil, nil
+	}
+
+	return data, nil
+}
+
+// Storage reads the storage value for addrHash/storageHash directly from
+// the database.
+func (dl *diskLayer) Storage(addrHash, storageHash common.Hash) ([]byte, error) {
+	if dl.Stale() {
+		return nil, ErrSnapshotStale
+	}
+
+	data, err := dl.db.Get(storageSnapshotKey(addrHash, storageHash))
+	if err != nil {
+		return nil, nil
+	}
+
+	return data, nil
+}
+
+// AccountIterator returns an iterator over every account flushed into the
+// database so far.
+func (dl *diskLayer) AccountIterator() AccountIterator {
+	return newDiskAccountIterator(dl)
+}
+
+// StorageIterator returns an iterator over the storage slots of addrHash
+// flushed into the database so far.
+func (dl *diskLayer) StorageIterator(addrHash common.Hash) StorageIterator {
+	return newDiskStorageIterator(dl, addrHash)
+}
+
+// flatten merges diff (whose parent must be dl) into the disk layer,
+// writing its destructs, accounts and storage into batch, and returns a
+// fresh disk layer rooted at diff's root. dl itself is marked stale since
+// its data has now been superseded.
+func (dl *diskLayer) flatten(diff *diffLayer, batch database.Batch) *diskLayer {
+	for addrHash := range diff.destructSet {
+		it := newDiskStorageIterator(dl, addrHash)
+		for it.Next() {
+			batch.Delete(storageSnapshotKey(addrHash, it.Hash()))
+		}
+		it.Release()
+	}
+
+	for addrHash, account := range diff.accountData {
+		if len(account) == 0 {
+			batch.Delete(accountSnapshotKey(addrHash))
+		} else {
+			batch.Put(accountSnapshotKey(addrHash), account)
+		}
+	}
+
+	for addrHash, slots := range diff.storageData {
+		for storageHash, value := range slots {
+			if len(value) == 0 {
+				batch.Delete(storageSnapshotKey(addrHash, storageHash))
+			} else {
+				batch.Put(storageSnapshotKey(addrHash, storageHash), value)
+			}
+		}
+	}
+
+	dl.lock.Lock()
+	dl.stale = true
+	dl.lock.Unlock()
+
+	return newDiskLayer(dl.db, diff.root)
+}
@@ -0,0 +1,12 @@
+/**
+* @file
+* @copyright defined in go-seele/LICENSE
+ */
+
+package snapshot
+
+import "errors"
+
+// ErrSnapshotStale is returned when a layer has been invalidated by a later
+// flatten operation and must no longer be read from.
+var ErrSnapshotStale = errors.New("snapshot: layer stale")
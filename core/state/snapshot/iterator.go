@@ -0,0 +1,240 @@
+/**
+* @file
+* @copyright defined in go-seele/LICENSE
+ */
+
+package snapshot
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/seeleteam/go-seele/common"
+	"github.com/seeleteam/go-seele/database"
+)
+
+// AccountIterator walks the accounts visible in a snapshot layer, merging in
+// every ancestor layer so that the caller sees one consistent view.
+type AccountIterator interface {
+	// Next advances the iterator, returning false once exhausted.
+	Next() bool
+
+	// Hash returns the address hash at the current position.
+	Hash() common.Hash
+
+	// Account returns the serialized account at the current position.
+	Account() []byte
+
+	// Release frees any resources (e.g. database cursors) held by the
+	// iterator.
+	Release()
+}
+
+// StorageIterator walks the storage slots of one account visible in a
+// snapshot layer, merging in every ancestor layer.
+type StorageIterator interface {
+	// Next advances the iterator, returning false once exhausted.
+	Next() bool
+
+	// Hash returns the storage key hash at the current position.
+	Hash() common.Hash
+
+	// Slot returns the storage value at the current position.
+	Slot() []byte
+
+	// Release frees any resources (e.g. database cursors) held by the
+	// iterator.
+	Release()
+}
+
+// diskAccountIterator iterates every account key flushed into the database.
+type diskAccountIterator struct {
+	it database.Iterator
+}
+
+func newDiskAccountIterator(dl *diskLayer) *diskAccountIterator {
+	return &diskAccountIterator{it: dl.db.NewIterator(snapshotAccountPrefix)}
+}
+
+func (it *diskAccountIterator) Next() bool { return it.it.Next() }
+
+func (it *diskAccountIterator) Hash() common.Hash {
+	return common.BytesToHash(it.it.Key()[len(snapshotAccountPrefix):])
+}
+
+func (it *diskAccountIterator) Account() []byte { return it.it.Value() }
+
+func (it *diskAccountIterator) Release() { it.it.Release() }
+
+// diskStorageIterator iterates every storage key of a single address flushed
+// into the database.
+type diskStorageIterator struct {
+	it       database.Iterator
+	prefix   []byte
+	addrHash common.Hash
+}
+
+func newDiskStorageIterator(dl *diskLayer, addrHash common.Hash) *diskStorageIterator {
+	prefix := append(append([]byte{}, snapshotStoragePrefix...), addrHash.Bytes()...)
+
+	return &diskStorageIterator{
+		it:       dl.db.NewIterator(prefix),
+		prefix:   prefix,
+		addrHash: addrHash,
+	}
+}
+
+func (it *diskStorageIterator) Next() bool { return it.it.Next() }
+
+func (it *diskStorageIterator) Hash() common.Hash {
+	return common.BytesToHash(it.it.Key()[len(it.prefix):])
+}
+
+func (it *diskStorageIterator) Slot() []byte { return it.it.Value() }
+
+func (it *diskStorageIterator) Release() { it.it.Release() }
+
+// mergedAccountIterator walks a pre-resolved, sorted set of address hashes,
+// used to present the result of merging a diff layer with its ancestors as
+// a single AccountIterator.
+type mergedAccountIterator struct {
+	hashes []common.Hash
+	values map[common.Hash][]byte
+	pos    int
+}
+
+func (it *mergedAccountIterator) Next() bool {
+	it.pos++
+	return it.pos < len(it.hashes)
+}
+
+func (it *mergedAccountIterator) Hash() common.Hash { return it.hashes[it.pos] }
+
+func (it *mergedAccountIterator) Account() []byte { return it.values[it.hashes[it.pos]] }
+
+func (it *mergedAccountIterator) Release() {}
+
+// newDiffAccountIterator resolves the set of live accounts visible from
+// start down through every ancestor layer, newest layer wins.
+func newDiffAccountIterator(start *diffLayer) AccountIterator {
+	resolved := make(map[common.Hash][]byte)
+
+	var cur Snapshot = start
+	for {
+		diff, ok := cur.(*diffLayer)
+		if !ok {
+			break
+		}
+
+		diff.lock.RLock()
+		for addrHash, account := range diff.accountData {
+			if _, done := resolved[addrHash]; !done {
+				resolved[addrHash] = account
+			}
+		}
+		for addrHash := range diff.destructSet {
+			if _, done := resolved[addrHash]; !done {
+				resolved[addrHash] = nil
+			}
+		}
+		parent := diff.parent
+		diff.lock.RUnlock()
+
+		cur = parent
+	}
+
+	if dl, ok := cur.(*diskLayer); ok {
+		it := newDiskAccountIterator(dl)
+		for it.Next() {
+			if _, done := resolved[it.Hash()]; !done {
+				resolved[it.Hash()] = it.Account()
+			}
+		}
+		it.Release()
+	}
+
+	hashes := make([]common.Hash, 0, len(resolved))
+	for addrHash, account := range resolved {
+		if len(account) == 0 {
+			continue // deleted or destructed account
+		}
+		hashes = append(hashes, addrHash)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i][:], hashes[j][:]) < 0 })
+
+	return &mergedAccountIterator{hashes: hashes, values: resolved, pos: -1}
+}
+
+// mergedStorageIterator walks a pre-resolved, sorted set of storage key
+// hashes for a single account.
+type mergedStorageIterator struct {
+	hashes []common.Hash
+	values map[common.Hash][]byte
+	pos    int
+}
+
+func (it *mergedStorageIterator) Next() bool {
+	it.pos++
+	return it.pos < len(it.hashes)
+}
+
+func (it *mergedStorageIterator) Hash() common.Hash { return it.hashes[it.pos] }
+
+func (it *mergedStorageIterator) Slot() []byte { return it.values[it.hashes[it.pos]] }
+
+func (it *mergedStorageIterator) Release() {}
+
+// newDiffStorageIterator resolves the set of live storage slots of addrHash
+// visible from start down through every ancestor layer, stopping at a
+// destructed entry like newDiffAccountIterator does.
+func newDiffStorageIterator(start *diffLayer, addrHash common.Hash) StorageIterator {
+	resolved := make(map[common.Hash][]byte)
+
+	var cur Snapshot = start
+	for {
+		diff, ok := cur.(*diffLayer)
+		if !ok {
+			break
+		}
+
+		diff.lock.RLock()
+		if slots, ok := diff.storageData[addrHash]; ok {
+			for key, value := range slots {
+				if _, done := resolved[key]; !done {
+					resolved[key] = value
+				}
+			}
+		}
+		_, destructed := diff.destructSet[addrHash]
+		parent := diff.parent
+		diff.lock.RUnlock()
+
+		if destructed {
+			cur = nil
+			break
+		}
+
+		cur = parent
+	}
+
+	if dl, ok := cur.(*diskLayer); ok {
+		it := newDiskStorageIterator(dl, addrHash)
+		for it.Next() {
+			if _, done := resolved[it.Hash()]; !done {
+				resolved[it.Hash()] = it.Slot()
+			}
+		}
+		it.Release()
+	}
+
+	keys := make([]common.Hash, 0, len(resolved))
+	for key, value := range resolved {
+		if len(value) == 0 {
+			continue // deleted slot
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+
+	return &mergedStorageIterator{hashes: keys, values: resolved, pos: -1}
+}
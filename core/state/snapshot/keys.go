@@ -0,0 +1,28 @@
+/**
+* @file
+* @copyright defined in go-seele/LICENSE
+ */
+
+package snapshot
+
+import "github.com/seeleteam/go-seele/common"
+
+// Key prefixes used to namespace the flattened account/storage snapshot
+// inside the shared database, kept distinct from the trie node keys.
+var (
+	snapshotAccountPrefix = []byte("SnA")
+	snapshotStoragePrefix = []byte("SnS")
+)
+
+// accountSnapshotKey returns the database key under which the serialized
+// account for addrHash is stored.
+func accountSnapshotKey(addrHash common.Hash) []byte {
+	return append(append([]byte{}, snapshotAccountPrefix...), addrHash.Bytes()...)
+}
+
+// storageSnapshotKey returns the database key under which the storage value
+// for addrHash/storageHash is stored.
+func storageSnapshotKey(addrHash, storageHash common.Hash) []byte {
+	key := append(append([]byte{}, snapshotStoragePrefix...), addrHash.Bytes()...)
+	return append(key, storageHash.Bytes()...)
+}
@@ -0,0 +1,151 @@
+/**
+* @file
+* @copyright defined in go-seele/LICENSE
+ */
+
+// Package snapshot maintains a flattened, O(1)-readable view of account and
+// storage state on top of the persistent database, as a fast alternative to
+// walking the state trie. It is organized as a disk layer holding state that
+// has been flushed to the database, topped by a stack of in-memory diff
+// layers, one per recently processed block.
+package snapshot
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/seeleteam/go-seele/common"
+	"github.com/seeleteam/go-seele/database"
+)
+
+// diffLayerCap is the maximum number of diff layers kept stacked on top of
+// the disk layer before the oldest one is merged down and flushed.
+const diffLayerCap = 128
+
+// Snapshot is implemented by both the disk layer and diff layers, and offers
+// a point-lookup view of account and storage state as of a given root.
+type Snapshot interface {
+	// Root returns the state root this snapshot layer represents.
+	Root() common.Hash
+
+	// Account returns the serialized account for addrHash, or nil if the
+	// account does not exist at this layer.
+	Account(addrHash common.Hash) ([]byte, error)
+
+	// Storage returns the storage value for addrHash/storageHash, or nil if
+	// the slot is unset at this layer.
+	Storage(addrHash, storageHash common.Hash) ([]byte, error)
+
+	// Parent returns the next older layer, or nil for the disk layer.
+	Parent() Snapshot
+
+	// Stale reports whether this layer has been invalidated by a later
+	// merge into the disk layer; its data must no longer be trusted.
+	Stale() bool
+
+	// AccountIterator returns an iterator over every account visible from
+	// this layer, merging in all of its ancestors.
+	AccountIterator() AccountIterator
+
+	// StorageIterator returns an iterator over the storage slots of
+	// addrHash visible from this layer, merging in all of its ancestors.
+	StorageIterator(addrHash common.Hash) StorageIterator
+}
+
+// Tree indexes every known snapshot layer by the state root it represents.
+type Tree struct {
+	lock   sync.RWMutex
+	layers map[common.Hash]Snapshot
+}
+
+// NewTree creates a snapshot tree seeded with a single disk layer rooted at
+// root, reading through to db on a miss.
+func NewTree(db database.Database, root common.Hash) *Tree {
+	return &Tree{
+		layers: map[common.Hash]Snapshot{
+			root: newDiskLayer(db, root),
+		},
+	}
+}
+
+// Snapshot returns the layer rooted at root, or nil if root is unknown.
+func (t *Tree) Snapshot(root common.Hash) Snapshot {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.layers[root]
+}
+
+// Update builds a new diff layer on top of parentRoot, capturing the
+// accounts and storage slots touched while processing the block that
+// produced root, and indexes it so that Snapshot(root) finds it.
+func (t *Tree) Update(root, parentRoot common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	parent, ok := t.layers[parentRoot]
+	if !ok {
+		return fmt.Errorf("snapshot: parent layer [%s] not found", parentRoot.Hex())
+	}
+
+	t.layers[root] = newDiffLayer(parent, root, destructs, accounts, storage)
+
+	return nil
+}
+
+// Cap merges the diff layer chain rooted at root down into the disk layer
+// once it grows deeper than diffLayerCap, flushing the oldest layer's
+// changes into batch. A nil batch (e.g. a Commit taken only to compute an
+// intermediate root) is a no-op: merging without persisting would stale a
+// layer's data without ever writing it to disk.
+func (t *Tree) Cap(root common.Hash, batch database.Batch) error {
+	if batch == nil {
+		return nil
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	snap, ok := t.layers[root]
+	if !ok {
+		return fmt.Errorf("snapshot: layer [%s] not found", root.Hex())
+	}
+
+	chain := make([]*diffLayer, 0, diffLayerCap+1)
+	for cur := snap; cur != nil; cur = cur.Parent() {
+		diff, ok := cur.(*diffLayer)
+		if !ok {
+			break
+		}
+		chain = append(chain, diff)
+	}
+
+	if len(chain) <= diffLayerCap {
+		return nil
+	}
+
+	bottom := chain[len(chain)-1]
+
+	disk, ok := bottom.Parent().(*diskLayer)
+	if !ok {
+		// Parent is already being merged by a concurrent Cap; nothing to do.
+		return nil
+	}
+
+	merged := disk.flatten(bottom, batch)
+
+	bottom.lock.Lock()
+	bottom.stale = true
+	bottom.lock.Unlock()
+
+	delete(t.layers, bottom.root)
+	t.layers[merged.root] = merged
+
+	for _, diff := range chain[:len(chain)-1] {
+		if diff.parent == Snapshot(bottom) {
+			diff.parent = merged
+		}
+	}
+
+	return nil
+}
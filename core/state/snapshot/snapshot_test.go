@@ -0,0 +1,91 @@
+/**
+* @file
+* @copyright defined in go-seele/LICENSE
+ */
+
+package snapshot
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/seeleteam/go-seele/common"
+)
+
+// testHash returns a distinct hash for every i.
+func testHash(i int) common.Hash {
+	var h common.Hash
+	binary.BigEndian.PutUint32(h[len(h)-4:], uint32(i))
+	return h
+}
+
+// TestDestructThenRecreateDoesNotBleedOldStorage guards the invariant this
+// package is built around: destroying an account and recreating it within
+// the same diff layer must not let its pre-destruct storage slots leak
+// through to the recreated account via the parent chain.
+func TestDestructThenRecreateDoesNotBleedOldStorage(t *testing.T) {
+	root0, root1, root2 := testHash(0), testHash(1), testHash(2)
+	addrHash, slot := testHash(100), testHash(200)
+
+	tree := NewTree(nil, root0)
+
+	// Block 1: the account is created and writes one storage slot.
+	accountsV1 := map[common.Hash][]byte{addrHash: []byte("account-v1")}
+	storageV1 := map[common.Hash]map[common.Hash][]byte{addrHash: {slot: []byte("v1")}}
+	if err := tree.Update(root1, root0, nil, accountsV1, storageV1); err != nil {
+		t.Fatalf("Update(root1): %v", err)
+	}
+
+	// Block 2: the account is suicided and recreated in the same block,
+	// without rewriting the slot it had before.
+	destructs := map[common.Hash]struct{}{addrHash: {}}
+	accountsV2 := map[common.Hash][]byte{addrHash: []byte("account-v2")}
+	if err := tree.Update(root2, root1, destructs, accountsV2, nil); err != nil {
+		t.Fatalf("Update(root2): %v", err)
+	}
+
+	snap := tree.Snapshot(root2)
+	if snap == nil {
+		t.Fatalf("Snapshot(root2) = nil")
+	}
+
+	account, err := snap.Account(addrHash)
+	if err != nil {
+		t.Fatalf("Account: %v", err)
+	}
+	if string(account) != "account-v2" {
+		t.Fatalf("Account = %q, want account-v2", account)
+	}
+
+	value, err := snap.Storage(addrHash, slot)
+	if err != nil {
+		t.Fatalf("Storage: %v", err)
+	}
+	if value != nil {
+		t.Fatalf("Storage = %q, want nil: old slot bled through a destroy-then-recreate", value)
+	}
+}
+
+// TestCapNilBatchIsANoOp checks that Cap with a nil batch (an intermediate
+// Commit(nil)) merges nothing, even once the diff layer chain grows past
+// diffLayerCap: the disk layer stays indexed and is not marked stale.
+func TestCapNilBatchIsANoOp(t *testing.T) {
+	root := testHash(0)
+	tree := NewTree(nil, root)
+
+	for i := 1; i <= diffLayerCap+1; i++ {
+		next := testHash(1000 + i)
+		if err := tree.Update(next, root, nil, nil, nil); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		root = next
+	}
+
+	if err := tree.Cap(root, nil); err != nil {
+		t.Fatalf("Cap(root, nil) = %v, want nil", err)
+	}
+
+	if disk := tree.Snapshot(testHash(0)); disk == nil || disk.Stale() {
+		t.Fatalf("Cap(root, nil) merged the disk layer, want it untouched")
+	}
+}
@@ -0,0 +1,278 @@
+/**
+* @file
+* @copyright defined in go-seele/LICENSE
+ */
+
+package state
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/seeleteam/go-seele/common"
+	"github.com/seeleteam/go-seele/crypto"
+	"github.com/seeleteam/go-seele/database"
+	"github.com/seeleteam/go-seele/trie"
+)
+
+// Account is the account data serialized into the state trie.
+type Account struct {
+	Nonce           uint64
+	Amount          *big.Int
+	CodeHash        []byte
+	StorageRootHash common.Hash
+}
+
+// StateObject is the state of an account being modified.
+type StateObject struct {
+	address  common.Address
+	addrHash common.Hash // cached hash of address, used as the snapshot key
+	account  Account
+
+	storageTrie *trie.Trie
+
+	code []byte
+
+	cachedStorage map[common.Hash][]byte
+	dirtyStorage  map[common.Hash][]byte
+
+	dirtyAccount bool
+	dirtyCode    bool
+	suicided     bool
+	deleted      bool
+}
+
+// newStateObject creates a state object with a zero balance. It does not
+// touch the database; callers are responsible for caching it.
+func newStateObject(addr common.Address) *StateObject {
+	return &StateObject{
+		address:  addr,
+		addrHash: crypto.HashBytes(addr.Bytes()),
+		account: Account{
+			Amount: new(big.Int),
+		},
+		cachedStorage: make(map[common.Hash][]byte),
+		dirtyStorage:  make(map[common.Hash][]byte),
+	}
+}
+
+// AddrHash returns the hash of the account address, used to key the account
+// and storage snapshot layers.
+func (o *StateObject) AddrHash() common.Hash {
+	return o.addrHash
+}
+
+// deepCopy returns a copy of the state object that shares no mutable state
+// with the original, used to snapshot an object before it is replaced.
+func (o *StateObject) deepCopy() *StateObject {
+	cpy := &StateObject{
+		address:  o.address,
+		addrHash: o.addrHash,
+		account: Account{
+			Nonce:           o.account.Nonce,
+			Amount:          new(big.Int).Set(o.account.Amount),
+			CodeHash:        common.CopyBytes(o.account.CodeHash),
+			StorageRootHash: o.account.StorageRootHash,
+		},
+		code:          common.CopyBytes(o.code),
+		cachedStorage: make(map[common.Hash][]byte, len(o.cachedStorage)),
+		dirtyStorage:  make(map[common.Hash][]byte, len(o.dirtyStorage)),
+		dirtyAccount:  o.dirtyAccount,
+		dirtyCode:     o.dirtyCode,
+		suicided:      o.suicided,
+		deleted:       o.deleted,
+	}
+
+	for k, v := range o.cachedStorage {
+		cpy.cachedStorage[k] = v
+	}
+
+	for k, v := range o.dirtyStorage {
+		cpy.dirtyStorage[k] = v
+	}
+
+	return cpy
+}
+
+// GetAmount returns the account balance.
+func (o *StateObject) GetAmount() *big.Int {
+	return o.account.Amount
+}
+
+// SetAmount sets the account balance.
+func (o *StateObject) SetAmount(amount *big.Int) {
+	o.setAmount(amount)
+}
+
+// AddAmount adds the given amount to the account balance.
+func (o *StateObject) AddAmount(amount *big.Int) {
+	o.setAmount(new(big.Int).Add(o.account.Amount, amount))
+}
+
+// SubAmount subtracts the given amount from the account balance.
+func (o *StateObject) SubAmount(amount *big.Int) {
+	o.setAmount(new(big.Int).Sub(o.account.Amount, amount))
+}
+
+func (o *StateObject) setAmount(amount *big.Int) {
+	o.account.Amount = amount
+	o.dirtyAccount = true
+}
+
+// GetNonce returns the account nonce.
+func (o *StateObject) GetNonce() uint64 {
+	return o.account.Nonce
+}
+
+// SetNonce sets the account nonce.
+func (o *StateObject) SetNonce(nonce uint64) {
+	o.setNonce(nonce)
+}
+
+func (o *StateObject) setNonce(nonce uint64) {
+	o.account.Nonce = nonce
+	o.dirtyAccount = true
+}
+
+// GetCode returns the contract code of the account, loading it from the
+// database and caching it on first access.
+func (o *StateObject) GetCode(db database.Database) []byte {
+	if o.code != nil {
+		return o.code
+	}
+
+	if len(o.account.CodeHash) == 0 {
+		return nil
+	}
+
+	code, err := db.Get(o.account.CodeHash)
+	if err != nil {
+		return nil
+	}
+
+	o.code = code
+	return code
+}
+
+// SetCode sets the contract code of the account.
+func (o *StateObject) SetCode(code []byte) {
+	hash := crypto.HashBytes(code)
+	o.setCode(hash.Bytes(), code)
+}
+
+func (o *StateObject) setCode(codeHash, code []byte) {
+	o.code = code
+	o.account.CodeHash = codeHash
+	o.dirtyCode = true
+}
+
+// serializeCode writes the contract code into the batch, keyed by code hash.
+func (o *StateObject) serializeCode(batch database.Batch) {
+	if len(o.code) > 0 {
+		batch.Put(o.account.CodeHash, o.code)
+	}
+}
+
+// GetState returns the storage value for the given key, consulting the
+// dirty and cached storage maps before falling back to the storage trie.
+func (o *StateObject) GetState(db database.Database, key common.Hash) []byte {
+	if value, ok := o.dirtyStorage[key]; ok {
+		return value
+	}
+
+	if value, ok := o.cachedStorage[key]; ok {
+		return value
+	}
+
+	defer storageReadTimer.UpdateSince(time.Now())
+
+	tr, err := o.getStorageTrie(db)
+	if err != nil {
+		return nil
+	}
+
+	value, _ := tr.Get(key[:])
+	o.cachedStorage[key] = value
+
+	return value
+}
+
+// SetState sets the storage value for the given key.
+func (o *StateObject) SetState(db database.Database, key common.Hash, value []byte) {
+	o.setState(key, value)
+}
+
+func (o *StateObject) setState(key common.Hash, value []byte) {
+	o.cachedStorage[key] = value
+	o.dirtyStorage[key] = value
+}
+
+// getStorageTrie lazily opens the account's storage trie, namespaced by
+// account address so that all accounts can share the underlying database.
+func (o *StateObject) getStorageTrie(db database.Database) (*trie.Trie, error) {
+	if o.storageTrie != nil {
+		return o.storageTrie, nil
+	}
+
+	tr, err := trie.NewTrie(o.account.StorageRootHash, o.address.Bytes(), db)
+	if err != nil {
+		return nil, err
+	}
+
+	o.storageTrie = tr
+	return o.storageTrie, nil
+}
+
+// updateStorageTrie applies the account's dirty storage entries to its
+// in-memory storage trie, without writing anything to the database yet.
+// Since it only touches this object's own trie, it is safe to call
+// concurrently across different accounts, letting Statedb.Commit hash every
+// dirty contract's storage trie in parallel before committing them one at a
+// time.
+func (o *StateObject) updateStorageTrie(db database.Database) error {
+	if len(o.dirtyStorage) == 0 {
+		return nil
+	}
+
+	tr, err := o.getStorageTrie(db)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range o.dirtyStorage {
+		if len(value) == 0 {
+			tr.Delete(key[:])
+		} else {
+			tr.Put(key[:], value)
+		}
+
+		delete(o.dirtyStorage, key)
+	}
+
+	return nil
+}
+
+// commitStorageTrie writes the account's storage trie into batch and
+// updates the account's storage root accordingly. It calls updateStorageTrie
+// itself, so it is safe to use directly when the trie wasn't already
+// updated ahead of time.
+func (o *StateObject) commitStorageTrie(db database.Database, batch database.Batch) error {
+	if err := o.updateStorageTrie(db); err != nil {
+		return err
+	}
+
+	if o.storageTrie == nil {
+		return nil
+	}
+
+	o.account.StorageRootHash = o.storageTrie.Commit(batch)
+	o.dirtyAccount = true
+
+	return nil
+}
+
+// markSuicided marks the account as suicided. The account is removed from
+// the trie the next time it is committed.
+func (o *StateObject) markSuicided() {
+	o.suicided = true
+}
@@ -6,28 +6,61 @@
 package state
 
 import (
+	"fmt"
 	"math/big"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/golang-lru"
 	"github.com/seeleteam/go-seele/common"
+	"github.com/seeleteam/go-seele/core/state/snapshot"
 	"github.com/seeleteam/go-seele/core/types"
+	"github.com/seeleteam/go-seele/crypto"
 	"github.com/seeleteam/go-seele/database"
 	"github.com/seeleteam/go-seele/trie"
 )
 
-// StateCacheCapacity is the capacity of state cache
+// StateCacheCapacity is the soft capacity of the state cache: cache()/
+// evictClean() try to keep stateObjects at or below this many entries, but
+// only by evicting clean ones.
 const StateCacheCapacity = 1000
 
+// stateObjectsHardLimit is the size passed to the underlying lru.Cache. It
+// is intentionally far above StateCacheCapacity so the library's own
+// capacity enforcement never triggers; lru.Cache.Add has no notion of
+// "dirty" and would otherwise evict a pending write on its own.
+const stateObjectsHardLimit = 1 << 30
+
 var (
 	stateBalance0 = big.NewInt(0)
 )
 
+// revision is a (id, journal length) pair recorded by Snapshot so that
+// RevertToSnapshot knows how far back to unwind the journal.
+type revision struct {
+	id           int
+	journalIndex int
+}
+
 // Statedb is used to store accounts into the MPT tree
 type Statedb struct {
+	root         common.Hash // root this Statedb was opened at or last committed to, used for snapshot reads and as the snapshot parent on Commit
 	db           database.Database
 	trie         *trie.Trie
 	stateObjects *lru.Cache // stateObjects maps account addresses of common.Address type to the state objects of *StateObject type
 
+	// stateObjectsDirty holds the addresses touched by a journaled
+	// mutation since the last Commit; Commit only re-serializes these.
+	stateObjectsDirty map[common.Address]struct{}
+
+	// stateObjectsDestructed holds every address suicided this block, even
+	// if it was since recreated; snapshotOne consults this instead of the
+	// live object's suicided flag.
+	stateObjectsDestructed map[common.Address]struct{}
+
+	snaps *snapshot.Tree // optional snapshot tree for O(1) account/storage reads; nil disables it
+
 	dbErr  error  // dbErr is used for record the database error.
 	refund uint64 // The refund counter, also used by state transitioning.
 
@@ -37,6 +70,10 @@ type Statedb struct {
 
 	// State modifications for current processed tx.
 	curJournal journal
+
+	// validRevisions and nextRevisionId support Snapshot/RevertToSnapshot.
+	validRevisions []revision
+	nextRevisionId int
 }
 
 // NewStatedb constructs and returns a statedb instance
@@ -46,30 +83,41 @@ func NewStatedb(root common.Hash, db database.Database) (*Statedb, error) {
 		return nil, err
 	}
 
-	stateCache, err := lru.New(StateCacheCapacity)
+	stateCache, err := lru.New(stateObjectsHardLimit)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Statedb{
-		db:           db,
-		trie:         trie,
-		stateObjects: stateCache,
-		curJournal:   journal{},
+		root:                   root,
+		db:                     db,
+		trie:                   trie,
+		stateObjects:           stateCache,
+		stateObjectsDirty:      make(map[common.Address]struct{}),
+		stateObjectsDestructed: make(map[common.Address]struct{}),
+		curJournal:             journal{},
 	}, nil
 }
 
+// EnableSnapshot attaches a snapshot tree for O(1) account/storage lookups;
+// Commit publishes each block's diff into it.
+func (s *Statedb) EnableSnapshot(snaps *snapshot.Tree) {
+	s.snaps = snaps
+}
+
 // GetCopy is a memory copy of state db.
 func (s *Statedb) GetCopy() (*Statedb, error) {
-	copies, err := lru.New(StateCacheCapacity)
+	copies, err := lru.New(stateObjectsHardLimit)
 	if err != nil {
 		panic(err) // call panic, in case of the error which happens only when StateCacheCapacity is negative.
 	}
 
+	// Deep-copy every cached object so that mutating one Statedb (including
+	// via RevertToSnapshot) can never reach into the other's live view.
 	for _, k := range s.stateObjects.Keys() {
 		v, ok := s.stateObjects.Peek(k)
 		if ok {
-			copies.Add(k, v)
+			copies.Add(k, v.(*StateObject).deepCopy())
 		}
 	}
 
@@ -78,13 +126,47 @@ func (s *Statedb) GetCopy() (*Statedb, error) {
 		return nil, err
 	}
 
+	dirty := make(map[common.Address]struct{}, len(s.stateObjectsDirty))
+	for addr := range s.stateObjectsDirty {
+		dirty[addr] = struct{}{}
+	}
+
+	destructed := make(map[common.Address]struct{}, len(s.stateObjectsDestructed))
+	for addr := range s.stateObjectsDestructed {
+		destructed[addr] = struct{}{}
+	}
+
+	// Carry over the in-flight journal and its revisions too, so that a
+	// Snapshot taken before GetCopy can still be reverted on the copy.
+	journalEntries := make([]journalEntry, len(s.curJournal.entries))
+	copy(journalEntries, s.curJournal.entries)
+	for i, entry := range journalEntries {
+		if reset, ok := entry.(resetObjectChange); ok {
+			journalEntries[i] = resetObjectChange{prev: reset.prev.deepCopy()}
+		}
+	}
+
+	validRevisions := make([]revision, len(s.validRevisions))
+	copy(validRevisions, s.validRevisions)
+
 	return &Statedb{
-		db:           s.db,
-		trie:         cpyTrie,
-		stateObjects: copies,
+		root:                   s.root,
+		db:                     s.db,
+		trie:                   cpyTrie,
+		stateObjects:           copies,
+		stateObjectsDirty:      dirty,
+		stateObjectsDestructed: destructed,
+		snaps:                  s.snaps,
 
 		dbErr:  s.dbErr,
 		refund: s.refund,
+
+		curTxIndex: s.curTxIndex,
+		curLogs:    append([]*types.Log{}, s.curLogs...),
+
+		curJournal:     journal{entries: journalEntries},
+		validRevisions: validRevisions,
+		nextRevisionId: s.nextRevisionId,
 	}, nil
 }
 
@@ -95,6 +177,11 @@ func (s *Statedb) setError(err error) {
 	}
 }
 
+// markDirty records addr as touched by a mutation since the last Commit.
+func (s *Statedb) markDirty(addr common.Address) {
+	s.stateObjectsDirty[addr] = struct{}{}
+}
+
 // GetBalance returns the balance of the specified account if exists.
 // Otherwise, returns zero.
 func (s *Statedb) GetBalance(addr common.Address) *big.Int {
@@ -111,6 +198,7 @@ func (s *Statedb) SetBalance(addr common.Address, balance *big.Int) {
 	if object != nil {
 		s.curJournal.append(balanceChange{&addr, object.GetAmount()})
 		object.SetAmount(balance)
+		s.markDirty(addr)
 	}
 }
 
@@ -120,6 +208,7 @@ func (s *Statedb) AddBalance(addr common.Address, amount *big.Int) {
 	if object != nil {
 		s.curJournal.append(balanceChange{&addr, object.GetAmount()})
 		object.AddAmount(amount)
+		s.markDirty(addr)
 	}
 }
 
@@ -129,6 +218,7 @@ func (s *Statedb) SubBalance(addr common.Address, amount *big.Int) {
 	if object != nil {
 		s.curJournal.append(balanceChange{&addr, object.GetAmount()})
 		object.SubAmount(amount)
+		s.markDirty(addr)
 	}
 }
 
@@ -147,6 +237,7 @@ func (s *Statedb) SetNonce(addr common.Address, nonce uint64) {
 	if object != nil {
 		s.curJournal.append(nonceChange{&addr, object.GetNonce()})
 		object.SetNonce(nonce)
+		s.markDirty(addr)
 	}
 }
 
@@ -156,18 +247,121 @@ func (s *Statedb) Commit(batch database.Batch) (common.Hash, error) {
 		return common.EmptyHash, s.dbErr
 	}
 
-	for _, key := range s.stateObjects.Keys() {
-		value, ok := s.stateObjects.Peek(key)
-		if ok {
-			addr := key.(common.Address)
-			object := value.(*StateObject)
-			if err := s.commitOne(addr, object, batch); err != nil {
-				return common.EmptyHash, err
-			}
+	destructs := make(map[common.Hash]struct{})
+	accounts := make(map[common.Hash][]byte)
+	storage := make(map[common.Hash]map[common.Hash][]byte)
+
+	// Only accounts touched by a journaled mutation need to be re-serialized;
+	// accounts that were merely read into the cache are already identical to
+	// what's in the trie.
+	dirty := make([]*StateObject, 0, len(s.stateObjectsDirty))
+	storageSlots := 0
+
+	for addr := range s.stateObjectsDirty {
+		value, ok := s.stateObjects.Peek(addr)
+		if !ok {
+			continue
+		}
+
+		object := value.(*StateObject)
+		storageSlots += len(object.dirtyStorage)
+
+		if s.snaps != nil {
+			_, destructed := s.stateObjectsDestructed[addr]
+			snapshotOne(object, destructed, destructs, accounts, storage)
 		}
+
+		dirty = append(dirty, object)
 	}
 
-	return s.trie.Commit(batch), nil
+	// Phase 1 (IntermediateRoot): hash every dirty contract's storage trie
+	// in parallel, one goroutine per account, since each only ever touches
+	// its own trie.
+	hashStart := time.Now()
+
+	var wg sync.WaitGroup
+	for _, object := range dirty {
+		if len(object.dirtyStorage) == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func(obj *StateObject) {
+			defer wg.Done()
+			obj.updateStorageTrie(s.db)
+		}(object)
+	}
+	wg.Wait()
+
+	trieHashTimer.UpdateSince(hashStart)
+
+	// Phase 2 (Commit): flush every dirty account into batch and the account
+	// trie sequentially; the account trie and batch are not safe for
+	// concurrent use.
+	for _, object := range dirty {
+		if err := s.commitOne(object.address, object, batch); err != nil {
+			return common.EmptyHash, err
+		}
+	}
+
+	accountCommitMeter.Mark(int64(len(dirty)))
+	storageCommitMeter.Mark(int64(storageSlots))
+
+	s.stateObjectsDirty = make(map[common.Address]struct{})
+	s.stateObjectsDestructed = make(map[common.Address]struct{})
+
+	commitStart := time.Now()
+	root := s.trie.Commit(batch)
+	trieCommitTimer.UpdateSince(commitStart)
+
+	if s.snaps != nil {
+		if err := s.snaps.Update(root, s.root, destructs, accounts, storage); err != nil {
+			return common.EmptyHash, err
+		}
+
+		if err := s.snaps.Cap(root, batch); err != nil {
+			return common.EmptyHash, err
+		}
+	}
+
+	s.root = root
+
+	return root, nil
+}
+
+// snapshotOne records obj's contribution to the snapshot diff layer being
+// built for the block currently being committed. It must run before
+// updateStorageTrie (Commit's phase 1, or commitOne), which drains obj's
+// dirty storage into the storage trie.
+func snapshotOne(obj *StateObject, destructed bool, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) {
+	addrHash := obj.AddrHash()
+
+	if destructed {
+		destructs[addrHash] = struct{}{}
+	}
+
+	// A still-suicided object is removed from the trie by commitOne; an
+	// empty account entry marks it deleted in the snapshot as well.
+	if obj.suicided {
+		accounts[addrHash] = nil
+		return
+	}
+
+	if obj.dirtyAccount {
+		accounts[addrHash] = common.SerializePanic(obj.account)
+	}
+
+	if len(obj.dirtyStorage) > 0 {
+		slots := storage[addrHash]
+		if slots == nil {
+			slots = make(map[common.Hash][]byte, len(obj.dirtyStorage))
+			storage[addrHash] = slots
+		}
+
+		for key, value := range obj.dirtyStorage {
+			slots[crypto.HashBytes(key[:])] = value
+		}
+	}
 }
 
 func (s *Statedb) commitOne(addr common.Address, obj *StateObject, batch database.Batch) error {
@@ -199,31 +393,82 @@ func (s *Statedb) commitOne(addr common.Address, obj *StateObject, batch databas
 }
 
 func (s *Statedb) cache(addr common.Address, obj *StateObject) {
-	if s.stateObjects.Len() == StateCacheCapacity {
-		s.Commit(nil)
+	if s.stateObjects.Len() >= StateCacheCapacity {
+		s.evictClean()
+	}
+
+	s.stateObjects.Add(addr, obj)
+}
 
-		// clear a quarter of the cached state infos to avoid frequent commits
-		for i := 0; i < StateCacheCapacity/4; i++ {
-			s.stateObjects.RemoveOldest()
+// evictClean drops clean (unmodified since the last Commit) accounts until
+// the cache is back at StateCacheCapacity, or none are left. A dirty account
+// is never evicted this way: the underlying lru.Cache has no notion of
+// dirty, so stateObjects is sized far above StateCacheCapacity and this is
+// the only thing enforcing the soft limit.
+func (s *Statedb) evictClean() {
+	for _, key := range s.stateObjects.Keys() {
+		if s.stateObjects.Len() < StateCacheCapacity {
+			return
+		}
+
+		addr := key.(common.Address)
+		if _, dirty := s.stateObjectsDirty[addr]; dirty {
+			continue
 		}
+
+		s.stateObjects.Remove(addr)
 	}
 
-	s.stateObjects.Add(addr, obj)
+	// Every cached account is dirty; let the cache grow past its nominal
+	// capacity rather than lose an uncommitted change. It shrinks back once
+	// the next Commit clears stateObjectsDirty.
 }
 
 // GetOrNewStateObject gets or creates a state object
 func (s *Statedb) GetOrNewStateObject(addr common.Address) *StateObject {
 	object := s.getStateObject(addr)
 	if object == nil {
-		object = newStateObject(addr)
-		object.SetNonce(0)
-		s.cache(addr, object)
+		object = s.createObject(addr)
 	}
 
 	return object
 }
 
+// createObject creates a brand new state object for addr and journals the
+// creation so that it can be undone by RevertToSnapshot. If addr previously
+// held a suicided object, a deep copy of it is journaled instead so that a
+// revert restores the pre-suicide object rather than erasing it outright.
+func (s *Statedb) createObject(addr common.Address) *StateObject {
+	var prev *StateObject
+	if value, ok := s.stateObjects.Peek(addr); ok {
+		if object := value.(*StateObject); object.suicided || object.deleted {
+			prev = object.deepCopy()
+		}
+	}
+
+	object := newStateObject(addr)
+	object.SetNonce(0)
+
+	if prev != nil {
+		s.curJournal.append(resetObjectChange{prev: prev})
+	} else {
+		s.curJournal.append(createObjectChange{account: &addr})
+	}
+
+	s.markDirty(addr)
+	s.cache(addr, object)
+	return object
+}
+
+// setStateObject re-caches a state object without journaling the change,
+// used by journal entries to restore a previous object on revert.
+func (s *Statedb) setStateObject(object *StateObject) {
+	s.stateObjects.Add(object.address, object)
+}
+
 func (s *Statedb) getStateObject(addr common.Address) *StateObject {
+	defer accountReadTimer.UpdateSince(time.Now())
+
 	if value, ok := s.stateObjects.Get(addr); ok {
 		if object := value.(*StateObject); !object.deleted {
 			return object
@@ -234,6 +479,23 @@ func (s *Statedb) getStateObject(addr common.Address) *StateObject {
 	}
 
 	object := newStateObject(addr)
+
+	if s.snaps != nil {
+		if snap := s.snaps.Snapshot(s.root); snap != nil {
+			val, err := snap.Account(object.AddrHash())
+			if err == nil {
+				if len(val) == 0 {
+					return nil
+				}
+
+				if err := common.Deserialize(val, &object.account); err == nil {
+					s.cache(addr, object)
+					return object
+				}
+			}
+		}
+	}
+
 	val, _ := s.trie.Get(addr[:])
 	if len(val) == 0 {
 		return nil
@@ -253,9 +515,159 @@ func (s *Statedb) Prepare(txIndex int) {
 	s.curLogs = nil
 
 	s.curJournal.entries = s.curJournal.entries[:0]
+	s.validRevisions = s.validRevisions[:0]
+	s.nextRevisionId = 0
 }
 
 // GetCurrentLogs returns the current transaction logs.
 func (s *Statedb) GetCurrentLogs() []*types.Log {
 	return s.curLogs
 }
+
+// Snapshot records the current state modification journal position and
+// returns a revision id that can later be passed to RevertToSnapshot to
+// undo every change made since this call.
+func (s *Statedb) Snapshot() int {
+	id := s.nextRevisionId
+	s.nextRevisionId++
+
+	s.validRevisions = append(s.validRevisions, revision{id, s.curJournal.length()})
+
+	return id
+}
+
+// RevertToSnapshot undoes every state modification journaled since the
+// matching call to Snapshot.
+func (s *Statedb) RevertToSnapshot(revisionID int) {
+	idx := sort.Search(len(s.validRevisions), func(i int) bool {
+		return s.validRevisions[i].id >= revisionID
+	})
+
+	if idx == len(s.validRevisions) || s.validRevisions[idx].id != revisionID {
+		panic(fmt.Errorf("state: revision id %v cannot be reverted", revisionID))
+	}
+
+	snapshot := s.validRevisions[idx].journalIndex
+
+	s.curJournal.revert(s, snapshot)
+	s.validRevisions = s.validRevisions[:idx]
+}
+
+// GetState returns the storage value at the given key for the specified
+// account, or nil if the account or the key does not exist. Reads are
+// served from the attached snapshot, when available, before falling back
+// to the storage trie.
+func (s *Statedb) GetState(addr common.Address, key common.Hash) []byte {
+	object := s.getStateObject(addr)
+	if object == nil {
+		return nil
+	}
+
+	if value, ok := object.dirtyStorage[key]; ok {
+		return value
+	}
+
+	if value, ok := object.cachedStorage[key]; ok {
+		return value
+	}
+
+	if s.snaps != nil {
+		if snap := s.snaps.Snapshot(s.root); snap != nil {
+			if value, err := snap.Storage(object.AddrHash(), crypto.HashBytes(key[:])); err == nil {
+				object.cachedStorage[key] = value
+				return value
+			}
+		}
+	}
+
+	return object.GetState(s.db, key)
+}
+
+// SetState sets the storage value at the given key for the specified account.
+func (s *Statedb) SetState(addr common.Address, key common.Hash, value []byte) {
+	object := s.getStateObject(addr)
+	if object != nil {
+		s.curJournal.append(storageChange{
+			account:  &addr,
+			key:      key,
+			prevalue: object.GetState(s.db, key),
+		})
+
+		object.SetState(s.db, key, value)
+		s.markDirty(addr)
+	}
+}
+
+// GetCode returns the contract code of the specified account, or nil if the
+// account does not exist or is not a contract.
+func (s *Statedb) GetCode(addr common.Address) []byte {
+	object := s.getStateObject(addr)
+	if object != nil {
+		return object.GetCode(s.db)
+	}
+
+	return nil
+}
+
+// SetCode sets the contract code of the specified account.
+func (s *Statedb) SetCode(addr common.Address, code []byte) {
+	object := s.getStateObject(addr)
+	if object != nil {
+		s.curJournal.append(codeChange{
+			account:  &addr,
+			prevcode: object.GetCode(s.db),
+			prevhash: object.account.CodeHash,
+		})
+
+		object.SetCode(code)
+		s.markDirty(addr)
+	}
+}
+
+// Suicide marks the specified account to be deleted at the next Commit and
+// zeroes its balance. It returns false if the account does not exist.
+func (s *Statedb) Suicide(addr common.Address) bool {
+	object := s.getStateObject(addr)
+	if object == nil {
+		return false
+	}
+
+	s.curJournal.append(suicideChange{
+		account:     &addr,
+		prev:        object.suicided,
+		prevbalance: new(big.Int).Set(object.GetAmount()),
+	})
+
+	object.markSuicided()
+	object.SetAmount(new(big.Int))
+	s.markDirty(addr)
+	s.stateObjectsDestructed[addr] = struct{}{}
+
+	return true
+}
+
+// HasSuicided returns whether the specified account has been marked as
+// suicided since the last Commit.
+func (s *Statedb) HasSuicided(addr common.Address) bool {
+	object := s.getStateObject(addr)
+	return object != nil && object.suicided
+}
+
+// AddRefund adds the given amount to the refund counter, journaling the
+// previous value so it can be undone by RevertToSnapshot.
+func (s *Statedb) AddRefund(gas uint64) {
+	s.curJournal.append(refundChange{prev: s.refund})
+	s.refund += gas
+}
+
+// GetRefund returns the current value of the refund counter.
+func (s *Statedb) GetRefund() uint64 {
+	return s.refund
+}
+
+// AddLog appends a log entry produced by the current transaction, journaling
+// the append so it can be undone by RevertToSnapshot.
+func (s *Statedb) AddLog(log *types.Log) {
+	s.curJournal.append(addLogChange{})
+	s.curLogs = append(s.curLogs, log)
+}
@@ -0,0 +1,88 @@
+/**
+* @file
+* @copyright defined in go-seele/LICENSE
+ */
+
+package state
+
+import (
+	"encoding/binary"
+	"math/big"
+	"testing"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/seeleteam/go-seele/common"
+)
+
+// newTestStatedb builds a Statedb with just enough wired up to exercise the
+// state cache in isolation, without a trie or database behind it.
+func newTestStatedb(t *testing.T) *Statedb {
+	cache, err := lru.New(stateObjectsHardLimit)
+	if err != nil {
+		t.Fatalf("lru.New: %v", err)
+	}
+
+	return &Statedb{
+		stateObjects:           cache,
+		stateObjectsDirty:      make(map[common.Address]struct{}),
+		stateObjectsDestructed: make(map[common.Address]struct{}),
+		curJournal:             journal{},
+	}
+}
+
+// testAddress returns a distinct address for every i.
+func testAddress(i int) common.Address {
+	var addr common.Address
+	binary.BigEndian.PutUint32(addr[len(addr)-4:], uint32(i))
+	return addr
+}
+
+func fillCache(s *Statedb, from, to int) {
+	for i := from; i < to; i++ {
+		addr := testAddress(i)
+		s.cache(addr, newStateObject(addr))
+	}
+}
+
+func TestEvictionUnderPressureNeverLosesADirtyWrite(t *testing.T) {
+	s := newTestStatedb(t)
+	fillCache(s, 0, StateCacheCapacity)
+
+	dirty := testAddress(0)
+	s.SetBalance(dirty, big.NewInt(42))
+
+	// Touch enough clean accounts to push the cache well past capacity.
+	fillCache(s, StateCacheCapacity, StateCacheCapacity*3)
+
+	if balance := s.GetBalance(dirty); balance.Cmp(big.NewInt(42)) != 0 {
+		t.Fatalf("dirty account was evicted: balance = %v, want 42", balance)
+	}
+}
+
+func TestReadOnlyAccessDoesNotDirtyState(t *testing.T) {
+	s := newTestStatedb(t)
+	addr := testAddress(0)
+	s.cache(addr, newStateObject(addr))
+
+	s.GetBalance(addr)
+	s.GetNonce(addr)
+
+	if len(s.stateObjectsDirty) != 0 {
+		t.Fatalf("read-only access marked %d account(s) dirty", len(s.stateObjectsDirty))
+	}
+}
+
+func TestMidBlockEvictionThenReReadReturnsMutatedValue(t *testing.T) {
+	s := newTestStatedb(t)
+	fillCache(s, 0, StateCacheCapacity)
+
+	dirty := testAddress(0)
+	s.SetNonce(dirty, 7)
+
+	// Insert one more account so that cache() runs evictClean.
+	fillCache(s, StateCacheCapacity, StateCacheCapacity+1)
+
+	if nonce := s.GetNonce(dirty); nonce != 7 {
+		t.Fatalf("re-read after eviction returned nonce %d, want 7", nonce)
+	}
+}